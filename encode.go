@@ -0,0 +1,209 @@
+package flagconf
+
+import (
+	"encoding"
+	"errors"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+var (
+	tomlMarshalerType = reflect.TypeOf((*toml.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Encode writes config, which must be a struct or a pointer to a struct, to
+// w as a TOML document. Fields are written according to the same "toml"
+// struct tags used when decoding (including "toml:"-"" to omit a field),
+// and embedded/nested structs are traversed following Go's field-promotion
+// rules, the same way toml decodes them. Fields tagged "flag:"-"" are also omitted,
+// the same as they are from the command line, since that tag is the
+// documented way to keep a field (often a secret or computed-only value)
+// off of every surface flagconf exposes. A field whose type implements
+// toml.Marshaler or encoding.TextMarshaler is encoded using that method, the
+// same as it would be without this filtering.
+func Encode(w io.Writer, config interface{}) error {
+	v := reflect.ValueOf(config)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return toml.NewEncoder(w).Encode(config)
+		}
+		v = v.Elem()
+	}
+	visible, err := stripFlagHiddenFields(v)
+	if err != nil {
+		return err
+	}
+	return toml.NewEncoder(w).Encode(visible.Interface())
+}
+
+// stripFlagHiddenFields returns a copy of v with any field tagged
+// "flag:"-"" (and its contents) removed, recursing into embedded/nested
+// structs and slices of structs (TOML arrays of tables). Unlike
+// registerFlags, which walks every embedded field, it applies Go's
+// field-promotion rules to embedded structs. Values that aren't structs are
+// returned unchanged.
+func stripFlagHiddenFields(v reflect.Value) (reflect.Value, error) {
+	if v.Kind() == reflect.Ptr && v.Type().Elem().Kind() == reflect.Struct {
+		if v.IsNil() {
+			return v, nil
+		}
+		elem, err := stripFlagHiddenFields(v.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		p := reflect.New(elem.Type())
+		p.Elem().Set(elem)
+		return p, nil
+	}
+	if elemKind, isPtr := sliceStructElemKind(v.Type()); elemKind == reflect.Struct {
+		elemType := v.Type().Elem()
+		if isPtr {
+			elemType = elemType.Elem()
+		}
+		strippedElem, err := stripFlagHiddenFields(reflect.New(elemType).Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		sliceType := strippedElem.Type()
+		if isPtr {
+			sliceType = reflect.PtrTo(sliceType)
+		}
+		visible := reflect.MakeSlice(reflect.SliceOf(sliceType), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			elem := v.Index(i)
+			if isPtr {
+				if elem.IsNil() {
+					continue
+				}
+				elem = elem.Elem()
+			}
+			stripped, err := stripFlagHiddenFields(elem)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			if isPtr {
+				p := reflect.New(stripped.Type())
+				p.Elem().Set(stripped)
+				stripped = p
+			}
+			visible.Index(i).Set(stripped)
+		}
+		return visible, nil
+	}
+	if v.Kind() != reflect.Struct || marshalsItself(v.Type()) {
+		return v, nil
+	}
+	t := v.Type()
+
+	// reflect.VisibleFields already implements Go's field-promotion rules
+	// for embedded structs: a field promoted from a shallower embedding
+	// wins over one from a deeper embedding, and a name promoted by two
+	// or more embedded structs at the same depth is ambiguous and omitted
+	// entirely, the same as it would be for a real selector expression.
+	// That holds even when an embedded type's own name is unexported, so
+	// this promotes its exported fields the same as encoding/json and as
+	// toml itself decodes them (see TestEncodePromotesUnexportedEmbeddedFields).
+	var fields []reflect.StructField
+	var values []reflect.Value
+	for _, sf := range reflect.VisibleFields(t) {
+		if sf.Anonymous {
+			// The embedded field itself; its own exported fields (if any)
+			// are promoted to their own entries below instead, and
+			// reflect.StructOf refuses to build an anonymous field whose
+			// type has an unexported name anyway.
+			continue
+		}
+		if sf.PkgPath != "" {
+			// Unexported field; it can't be copied into the new struct
+			// below with reflect, and toml's own encoder skips it too.
+			continue
+		}
+		if flagHiddenAlongPath(t, sf.Index) {
+			continue
+		}
+		fv, err := stripFlagHiddenFields(fieldByIndexMaterialized(v, sf.Index))
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		sf.Type = fv.Type()
+		fields = append(fields, sf)
+		values = append(values, fv)
+	}
+
+	visible := reflect.New(reflect.StructOf(fields)).Elem()
+	for i, fv := range values {
+		visible.Field(i).Set(fv)
+	}
+	return visible, nil
+}
+
+// marshalsItself reports whether t (or *t) implements one of the interfaces
+// toml uses to marshal a value itself instead of walking its fields -
+// time.Time, toml.Marshaler, and encoding.TextMarshaler. Rebuilding such a
+// value field-by-field via reflect.StructOf, as stripFlagHiddenFields
+// does, would drop the method set that makes the custom marshaling work, so
+// these are passed through unchanged instead.
+func marshalsItself(t reflect.Type) bool {
+	if t == reflect.TypeOf(time.Time{}) {
+		return true
+	}
+	return t.Implements(tomlMarshalerType) || reflect.PtrTo(t).Implements(tomlMarshalerType) ||
+		t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType)
+}
+
+// flagHiddenAlongPath reports whether the field of t reached by index (as
+// returned by reflect.VisibleFields) is hidden by a "flag:"-"" tag on
+// itself or on an embedded field anywhere along the promotion path.
+func flagHiddenAlongPath(t reflect.Type, index []int) bool {
+	cur := t
+	for _, i := range index {
+		f := cur.Field(i)
+		if f.Tag.Get("flag") == "-" {
+			return true
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct {
+			cur = ft
+		}
+	}
+	return false
+}
+
+// fieldByIndexMaterialized is like v.FieldByIndex(index), except that a nil
+// pointer partway along the path is materialized to its zero value rather
+// than panicking, the same way registerFlags materializes nil struct
+// pointers: the set of promoted fields must be the same regardless of a
+// particular value's nil-ness, since (for a slice of structs) it has to
+// agree with every other element's slice element type.
+func fieldByIndexMaterialized(v reflect.Value, index []int) reflect.Value {
+	for i, fieldIndex := range index {
+		v = v.Field(fieldIndex)
+		if i < len(index)-1 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v = reflect.Zero(v.Type().Elem())
+			} else {
+				v = v.Elem()
+			}
+		}
+	}
+	return v
+}
+
+// ErrDumpedConfig is returned by ParseStrings and its variants after the
+// effective configuration has been written to standard output in response
+// to the -flagconf.dump-config or -flagconf.print-defaults flag. Callers
+// should treat it like flag.ErrHelp: print nothing further and exit
+// successfully.
+var ErrDumpedConfig = errors.New("flagconf: configuration dumped")
+
+// IsDumpedConfig reports whether err is ErrDumpedConfig.
+func IsDumpedConfig(err error) bool {
+	return err == ErrDumpedConfig
+}
@@ -0,0 +1,337 @@
+package flagconf
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestEncode(t *testing.T) {
+	config := &simpleCase{F1: 5}
+	var buf bytes.Buffer
+	if err := Encode(&buf, config); err != nil {
+		t.Fatal(err)
+	}
+	var decoded simpleCase
+	if _, err := toml.Decode(buf.String(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != *config {
+		t.Fatalf("got %#v, want %#v", decoded, *config)
+	}
+}
+
+func TestEncodeOmitsFlagDashFields(t *testing.T) {
+	config := &ignoreCase{F: 1, D: 2 * time.Second}
+	var buf bytes.Buffer
+	if err := Encode(&buf, config); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "D") {
+		t.Fatalf(`encoded config contains a field tagged flag:"-": %s`, buf.String())
+	}
+}
+
+type hiddenNestedCase struct {
+	Servers []*hiddenNestedServer
+}
+
+type hiddenNestedServer struct {
+	Host   string
+	Secret string `flag:"-"`
+}
+
+func TestEncodeOmitsNestedFlagDashFields(t *testing.T) {
+	config := &hiddenNestedCase{Servers: []*hiddenNestedServer{{Host: "a", Secret: "shh"}}}
+	var buf bytes.Buffer
+	if err := Encode(&buf, config); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "a") {
+		t.Fatalf("encoded config is missing a visible field: %s", out)
+	}
+	if strings.Contains(out, "shh") {
+		t.Fatalf(`encoded config contains a nested field tagged flag:"-": %s`, out)
+	}
+}
+
+type unexportedFieldCase struct {
+	Host   string
+	secret string
+}
+
+func TestEncodeSkipsUnexportedFields(t *testing.T) {
+	config := &unexportedFieldCase{Host: "a", secret: "x"}
+	var buf bytes.Buffer
+	if err := Encode(&buf, config); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "x") {
+		t.Fatalf("encoded config contains an unexported field: %s", buf.String())
+	}
+}
+
+type unexportedEmbeddedBase struct {
+	Host string
+}
+
+type unexportedEmbeddedCase struct {
+	unexportedEmbeddedBase
+	Port int
+}
+
+func TestEncodePromotesUnexportedEmbeddedFields(t *testing.T) {
+	config := &unexportedEmbeddedCase{unexportedEmbeddedBase: unexportedEmbeddedBase{Host: "a"}, Port: 1}
+	var buf bytes.Buffer
+	if err := Encode(&buf, config); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "Port") {
+		t.Fatalf("encoded config is missing a visible field: %s", out)
+	}
+	if !strings.Contains(out, "Host") {
+		t.Fatalf("encoded config is missing a promoted field from an unexported embedded type: %s", out)
+	}
+}
+
+type shadowedBase struct {
+	Name string
+}
+
+type shadowedCase struct {
+	shadowedBase
+	Name string
+}
+
+func TestEncodeShadowedEmbeddedField(t *testing.T) {
+	config := &shadowedCase{shadowedBase: shadowedBase{Name: "inner"}, Name: "outer"}
+	var buf bytes.Buffer
+	if err := Encode(&buf, config); err != nil {
+		t.Fatal(err)
+	}
+	var decoded shadowedCase
+	if _, err := toml.Decode(buf.String(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Name != "outer" {
+		t.Fatalf("got Name = %q, want %q (the outer field, which shadows the embedded one)", decoded.Name, "outer")
+	}
+}
+
+type embeddedPtrBase struct {
+	Host string
+}
+
+type embeddedPtrServer struct {
+	*embeddedPtrBase
+	Port int
+}
+
+type embeddedPtrServersCase struct {
+	Servers []*embeddedPtrServer
+}
+
+func TestEncodeSliceOfEmbeddedPointerStructs(t *testing.T) {
+	config := &embeddedPtrServersCase{Servers: []*embeddedPtrServer{
+		{embeddedPtrBase: nil, Port: 1},
+		{embeddedPtrBase: &embeddedPtrBase{Host: "a"}, Port: 2},
+	}}
+	var buf bytes.Buffer
+	if err := Encode(&buf, config); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "Host") {
+		t.Fatalf("encoded config is missing a promoted field from an embedded pointer: %s", out)
+	}
+}
+
+type ambiguousBaseA struct {
+	Name string
+}
+
+type ambiguousBaseB struct {
+	Name string
+}
+
+type ambiguousCase struct {
+	ambiguousBaseA
+	ambiguousBaseB
+}
+
+func TestEncodeDropsAmbiguousEmbeddedFields(t *testing.T) {
+	config := &ambiguousCase{ambiguousBaseA{Name: "a"}, ambiguousBaseB{Name: "b"}}
+	var buf bytes.Buffer
+	if err := Encode(&buf, config); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "Name") {
+		t.Fatalf("encoded config contains a field name promoted by two embedded structs, which is ambiguous: %s", buf.String())
+	}
+}
+
+type shallowBase struct {
+	Name string
+}
+
+type deepBase struct {
+	Name string
+}
+
+type deepMiddle struct {
+	deepBase
+}
+
+type depthCase struct {
+	deepMiddle
+	shallowBase
+}
+
+func TestEncodePrefersShallowerEmbeddedField(t *testing.T) {
+	config := &depthCase{
+		deepMiddle:  deepMiddle{deepBase: deepBase{Name: "deep"}},
+		shallowBase: shallowBase{Name: "shallow"},
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, config); err != nil {
+		t.Fatal(err)
+	}
+	var decoded depthCase
+	if _, err := toml.Decode(buf.String(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.shallowBase.Name != "shallow" {
+		t.Fatalf("got Name = %q, want %q (the field promoted from the shallower embedding)", decoded.shallowBase.Name, "shallow")
+	}
+}
+
+type level int
+
+func (l level) MarshalText() ([]byte, error) {
+	return []byte([]string{"low", "medium", "high"}[l]), nil
+}
+
+func (l *level) UnmarshalText(text []byte) error {
+	for i, name := range []string{"low", "medium", "high"} {
+		if string(text) == name {
+			*l = level(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown level %q", text)
+}
+
+type marshaledFieldCase struct {
+	Level level
+}
+
+func TestEncodePreservesTextMarshaler(t *testing.T) {
+	config := &marshaledFieldCase{Level: 2}
+	var buf bytes.Buffer
+	if err := Encode(&buf, config); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "high") {
+		t.Fatalf("encoded config doesn't use Level's MarshalText: %s", out)
+	}
+	var decoded marshaledFieldCase
+	if _, err := toml.Decode(out, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Level != config.Level {
+		t.Fatalf("got Level = %v, want %v", decoded.Level, config.Level)
+	}
+}
+
+func TestEncodeNilPointer(t *testing.T) {
+	var config *simpleCase
+	var buf bytes.Buffer
+	if err := Encode(&buf, config); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stdout
+	os.Stdout = w
+	f()
+	w.Close()
+	os.Stdout = orig
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestDumpConfig(t *testing.T) {
+	name := tempConfigFile(t, "f1 = 3")
+	defer os.Remove(name)
+
+	config := &simpleCase{F1: 1}
+	var err error
+	out := captureStdout(t, func() {
+		err = ParseStrings([]string{"test", "-flagconf.dump-config"}, name, config, false)
+	})
+	if !IsDumpedConfig(err) {
+		t.Fatalf("expected ErrDumpedConfig, got %v", err)
+	}
+	var decoded simpleCase
+	if _, err := toml.Decode(out, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.F1 != 3 {
+		t.Fatalf("dumped config has F1 = %d, want 3 (the config-file value)", decoded.F1)
+	}
+}
+
+func TestPrintDefaults(t *testing.T) {
+	name := tempConfigFile(t, "f1 = 3")
+	defer os.Remove(name)
+
+	config := &simpleCase{F1: 1}
+	var err error
+	out := captureStdout(t, func() {
+		err = ParseStrings([]string{"test", "-flagconf.print-defaults"}, name, config, false)
+	})
+	if !IsDumpedConfig(err) {
+		t.Fatalf("expected ErrDumpedConfig, got %v", err)
+	}
+	var decoded simpleCase
+	if _, err := toml.Decode(out, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.F1 != 1 {
+		t.Fatalf("printed defaults has F1 = %d, want 1 (the original default)", decoded.F1)
+	}
+}
+
+func TestDumpConfigFlagsHidden(t *testing.T) {
+	name := tempConfigFile(t, "f1 = 3")
+	defer os.Remove(name)
+
+	config := &simpleCase{F1: 1}
+	err := ParseStrings([]string{"test", "-bogus"}, name, config, false)
+	ferr, ok := err.(FlagError)
+	if !ok {
+		t.Fatalf("got %v, want a FlagError", err)
+	}
+	for _, name := range []string{"flagconf.dump-config", "flagconf.print-defaults"} {
+		if strings.Contains(ferr.Usage, name) {
+			t.Errorf("usage message unexpectedly mentions hidden flag %q:\n%s", name, ferr.Usage)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package flagconf
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envBinding associates an environment variable name with the config field
+// it should be applied to.
+type envBinding struct {
+	name string
+	v    reflect.Value
+}
+
+// addEnvBinding records that v may be set from an environment variable,
+// unless envTag is "-". The environment variable's name is envTag if it is
+// non-empty; otherwise it is derived from namespace (and envPrefix, if
+// given).
+func addEnvBinding(envBindings *[]envBinding, v reflect.Value, namespace, envTag, envPrefix string) {
+	if envBindings == nil || envTag == "-" || !v.CanAddr() {
+		return
+	}
+	name := envTag
+	if name == "" {
+		name = strings.ToUpper(strings.Replace(namespace, ".", "_", -1))
+		if envPrefix != "" {
+			name = envPrefix + "_" + name
+		}
+	}
+	*envBindings = append(*envBindings, envBinding{name: name, v: v})
+}
+
+// applyEnv overrides each binding's field with the value of its environment
+// variable, if set.
+func applyEnv(envBindings []envBinding) error {
+	for _, b := range envBindings {
+		s, ok := os.LookupEnv(b.name)
+		if !ok {
+			continue
+		}
+		if err := setFromString(b.v, s); err != nil {
+			return fmt.Errorf("flagconf: environment variable %s: %s", b.name, err)
+		}
+	}
+	return nil
+}
+
+// setFromString sets v (which must be addressable) from s, using the same
+// set of types that registerFlags supports.
+func setFromString(v reflect.Value, s string) error {
+	fvt := reflect.TypeOf((*flag.Value)(nil)).Elem()
+	if v.Addr().Type().Implements(fvt) {
+		return v.Addr().Interface().(flag.Value).Set(s)
+	}
+	switch v.Type() {
+	case reflect.TypeOf(false):
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.TypeOf(float64(0)):
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.TypeOf(int(0)), reflect.TypeOf(int64(0)):
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.TypeOf(uint(0)), reflect.TypeOf(uint64(0)):
+		u, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.TypeOf(""):
+		v.SetString(s)
+	case reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(d))
+	case reflect.TypeOf(time.Time{}):
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+	default:
+		return fmt.Errorf("unhandled type: %s", v.Type())
+	}
+	return nil
+}
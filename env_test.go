@@ -0,0 +1,82 @@
+package flagconf
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+type envCase struct {
+	F1 int `env:"MY_F1"`
+	F2 string
+}
+
+func withEnv(t *testing.T, vars map[string]string, f func()) {
+	for k, v := range vars {
+		if err := os.Setenv(k, v); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Unsetenv(k)
+	}
+	f()
+}
+
+func tempConfigFile(t *testing.T, contents string) string {
+	tempfile, err := ioutil.TempFile("", "flagconf-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tempfile.WriteString(contents); err != nil {
+		t.Fatal(err)
+	}
+	if err := tempfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return tempfile.Name()
+}
+
+func TestEnvOverlay(t *testing.T) {
+	withEnv(t, map[string]string{"MY_F1": "5", "F2": "env-value"}, func() {
+		name := tempConfigFile(t, "")
+		defer os.Remove(name)
+		config := &envCase{}
+		err := ParseStringsWithOptions([]string{"test"}, name, config, false, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := &envCase{F1: 5, F2: "env-value"}
+		if *config != *expected {
+			t.Fatalf("expected %#v, got %#v", expected, config)
+		}
+	})
+}
+
+func TestEnvOverlayFlagPrecedence(t *testing.T) {
+	withEnv(t, map[string]string{"MY_F1": "5"}, func() {
+		name := tempConfigFile(t, "")
+		defer os.Remove(name)
+		config := &envCase{}
+		err := ParseStringsWithOptions([]string{"test", "-f1=9"}, name, config, false, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.F1 != 9 {
+			t.Fatalf("expected flag to override environment variable, got F1=%d", config.F1)
+		}
+	})
+}
+
+func TestEnvOverlayPrefix(t *testing.T) {
+	withEnv(t, map[string]string{"APP_F2": "prefixed"}, func() {
+		name := tempConfigFile(t, "")
+		defer os.Remove(name)
+		config := &envCase{}
+		err := ParseStringsWithOptions([]string{"test"}, name, config, false, Options{EnvPrefix: "APP"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.F2 != "prefixed" {
+			t.Fatalf("expected F2 to be set from APP_F2, got %q", config.F2)
+		}
+	})
+}
@@ -1,9 +1,9 @@
-// Package flagconf combines the standard library's flag package
-// with Andrew Gallant's excellent TOML parsing library:
-// https://github.com/BurntSushi/toml.
+// Package flagconf combines the standard library's flag package with a
+// configuration file, decoded by a pluggable Source (TOML, JSON, and YAML
+// are supported out of the box).
 //
-// This package sets program options from a TOML configuration file
-// while allowing the settings to be overridden with command-line flags as well.
+// This package sets program options from a configuration file while
+// allowing the settings to be overridden with command-line flags as well.
 package flagconf
 
 import (
@@ -14,13 +14,16 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
-
-	"github.com/BurntSushi/toml"
+	"time"
 )
 
-// ParseStrings reads a TOML configuration file at path as well as
-// command-line arguments in args and sets matching options in config,
-// which must be a non-nil pointer to a struct.
+// ParseStrings reads a configuration file at path as well as command-line
+// arguments in args and sets matching options in config, which must be a
+// non-nil pointer to a struct.
+//
+// The file at path is decoded according to its extension: ".toml", ".json",
+// or ".yaml"/".yml". To use an explicit Source instead of dispatching on the
+// extension, call ParseStringsWithSource.
 //
 // ParseStrings is similar to Parse except that it provides the caller
 // with more fine-grained control.
@@ -32,6 +35,35 @@ import (
 // The allowNoConfig parameter controls whether ParseStrings returns an error
 // if no file is found at path.
 func ParseStrings(args []string, path string, config interface{}, allowNoConfigFile bool) error {
+	return ParseStringsWithOptions(args, path, config, allowNoConfigFile, Options{})
+}
+
+// ParseStringsWithSource is like ParseStrings except that the configuration
+// file at path is decoded with source instead of being dispatched
+// automatically based on the file extension.
+func ParseStringsWithSource(args []string, path string, config interface{}, allowNoConfigFile bool, source Source) error {
+	return ParseStringsWithOptions(args, path, config, allowNoConfigFile, Options{Source: source})
+}
+
+// Options holds the optional settings accepted by ParseStringsWithOptions.
+type Options struct {
+	// Source decodes the configuration file. If nil, the Source is chosen
+	// based on the file's extension (see ParseStrings).
+	Source Source
+
+	// EnvPrefix, if non-empty, is prepended (joined with an underscore) to
+	// the auto-derived environment variable name of every flag that does
+	// not have an explicit "env" struct tag.
+	EnvPrefix string
+}
+
+// ParseStringsWithOptions is like ParseStrings but takes an Options value
+// controlling the config file Source and the environment variable prefix.
+//
+// Settings are applied in increasing order of precedence: defaults given in
+// config, the configuration file, environment variables, and finally
+// command-line flags in args.
+func ParseStringsWithOptions(args []string, path string, config interface{}, allowNoConfigFile bool, opts Options) error {
 	if len(args) < 1 {
 		return fmt.Errorf("flagconf: ParseStrings called with empty args")
 	}
@@ -39,19 +71,54 @@ func ParseStrings(args []string, path string, config interface{}, allowNoConfigF
 	if v.Kind() != reflect.Ptr || reflect.Indirect(v).Kind() != reflect.Struct {
 		return fmt.Errorf("flagconf: config must be a pointer to a struct")
 	}
+	source := opts.Source
+	if source == nil {
+		var err error
+		source, err = sourceForPath(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Snapshot the defaults given in config before they're touched by the
+	// config file, for -flagconf.print-defaults.
+	defaults := reflect.New(reflect.Indirect(v).Type())
+	defaults.Elem().Set(reflect.Indirect(v))
+
+	// Load the config file. This happens before flags are registered so
+	// that slices of structs (TOML arrays of tables) are already populated
+	// with their final number of elements by the time registerFlags walks
+	// the config and creates their per-element flags.
+	if err := source.Decode(path, config); err != nil {
+		if !(os.IsNotExist(err) && allowNoConfigFile) {
+			return err
+		}
+	}
 
 	flagset := flag.NewFlagSet(args[0], flag.ContinueOnError)
 	// Create flags
-	if err := registerFlags(flagset, reflect.Indirect(v), "", ""); err != nil {
+	var envBindings []envBinding
+	if err := registerFlags(flagset, reflect.Indirect(v), defaults.Elem(), "", "", "", opts.EnvPrefix, &envBindings); err != nil {
 		return err
 	}
+	// dumpConfig and printDefaults are hidden: they're debugging escape
+	// hatches, not part of a program's normal configuration surface, so
+	// they're kept out of -h/usage output (see hiddenFlags and
+	// printDefaults below).
+	var dumpConfig, doPrintDefaults bool
+	flagset.BoolVar(&dumpConfig, "flagconf.dump-config", false,
+		"write the effective configuration to stdout as TOML and exit")
+	flagset.BoolVar(&doPrintDefaults, "flagconf.print-defaults", false,
+		"write config's default values, before the config file, environment, and flags are applied, to stdout as TOML and exit")
+	hiddenFlags := map[string]bool{
+		"flagconf.dump-config":    true,
+		"flagconf.print-defaults": true,
+	}
 
-	// Load TOML
-	_, err := toml.DecodeFile(path, config)
-	if err != nil {
-		if !(os.IsNotExist(err) && allowNoConfigFile) {
-			return err
-		}
+	// Override the config file with any settings given as environment
+	// variables.
+	if err := applyEnv(envBindings); err != nil {
+		return err
 	}
 
 	// Prevent flagset.Parse from printing error and usage to stderr if parsing
@@ -61,14 +128,27 @@ func ParseStrings(args []string, path string, config interface{}, allowNoConfigF
 	flagset.SetOutput(buf)
 
 	// Override any settings with configured flags
-	if err = flagset.Parse(args[1:]); err != nil {
+	if err := flagset.Parse(args[1:]); err != nil {
 		// In case flag parsing fails, return a custom error containing usage
 		// info if user wants to print it.
 		fmt.Fprintf(buf, "Usage of %s:\n", args[0])
-		flagset.PrintDefaults()
-		err = FlagError{Err: err, Usage: strings.TrimSpace(buf.String())}
+		printDefaults(flagset, hiddenFlags)
+		return FlagError{Err: err, Usage: strings.TrimSpace(buf.String())}
+	}
+
+	if doPrintDefaults {
+		if err := Encode(os.Stdout, defaults.Interface()); err != nil {
+			return err
+		}
+		return ErrDumpedConfig
 	}
-	return err
+	if dumpConfig {
+		if err := Encode(os.Stdout, config); err != nil {
+			return err
+		}
+		return ErrDumpedConfig
+	}
+	return nil
 }
 
 // FlagError combines error received from flag parsing with default usage info.
@@ -90,16 +170,43 @@ func IsHelp(err error) bool {
 	return err == flag.ErrHelp
 }
 
+// printDefaults writes flagset's usage message to flagset.Output, one entry
+// per flag in a layout like that of (*flag.FlagSet).PrintDefaults, omitting
+// flags whose name is in hidden. Unlike PrintDefaults, it shows every
+// non-empty default, including zero values such as 0 and false, does not
+// quote string defaults, and always puts the usage text on its own line.
+func printDefaults(flagset *flag.FlagSet, hidden map[string]bool) {
+	flagset.VisitAll(func(f *flag.Flag) {
+		if hidden[f.Name] {
+			return
+		}
+		name, usage := flag.UnquoteUsage(f)
+		out := flagset.Output()
+		fmt.Fprintf(out, "  -%s", f.Name)
+		if name != "" {
+			fmt.Fprintf(out, " %s", name)
+		}
+		fmt.Fprintf(out, "\n    \t%s", usage)
+		if f.DefValue != "" {
+			fmt.Fprintf(out, " (default %v)", f.DefValue)
+		}
+		fmt.Fprint(out, "\n")
+	})
+}
+
 /*
-Parse reads a TOML configuration file at path as well as user-supplied options
+Parse reads a configuration file at path as well as user-supplied options
 from os.Args and sets matching options in config, which must be a non-nil pointer to a struct.
+The file is decoded as TOML, JSON, or YAML according to its extension; see
+ParseStrings and Source for other ways to pick or plug in a decoder.
 
 Typical usage is that the user represents configuration options with a struct type
 and then populates a value of that type with the default configuration values.
 
 Then the user calls flagconf.Parse, passing in the path to the configuration file
 and a pointer to the configuration value. This function will read settings
-from the TOML file and then read the user-supplied arguments from os.Args.
+from the config file, then from the environment, and then read the
+user-supplied arguments from os.Args.
 
 Example
 
@@ -137,23 +244,27 @@ then conf will be:
     MaxProcs: 8
     Addr:     ":8888"
 
-(That is, TOML settings override the defaults and flags given override those.)
+(That is, config file settings override the defaults, environment variables
+override the config file, and flags given override those. See
+ParseStringsWithOptions for the "env" struct tag that controls this
+environment layer.)
 
 Descriptions for the flags are taken from the "desc" struct tag.
 A default description is created based on the field type if a tag is not provided.
 
-TOML matches are attempted for every exported field in the configuration struct.
+Config-file matches are attempted for every exported field in the configuration struct.
 Flag names are constructed for every exported field. Unexported fields,
 as well as exported fields tagged with `flag:"-"`, are ignored by flagconf.
 (If a field is ignored by using this tag, it is typically best to also use
-`toml:"-"` so that the field is not picked up by the TOML parser.)
+`toml:"-"` (or the equivalent "json"/"yaml" tag) so that the field is not
+picked up by the decoder.)
 
 Parse returns an error if no file can be found at path.
 
 Types
 
-The basic types flagconf supports are those which are directly supported by both
-package flag and TOML:
+The basic types flagconf supports are those which are directly supported by
+package flag and by all three config-file formats:
 
     bool
     string
@@ -163,9 +274,15 @@ package flag and TOML:
     uint64
     float64
 
-Flagconf also supports any type implementing flag.Value, as long as TOML also supports it.
+flagconf also gives first-class treatment to time.Duration (parsed the same
+way as flag's own -timeout=5s flags) and time.Time (parsed as RFC3339 when
+given as a flag or environment variable; TOML, JSON, and YAML decode
+time.Time natively).
 
-Finally, flagconf supports nesting by recursively inspecting structs
+Flagconf also supports any type implementing flag.Value, as long as the
+config-file decoder also supports it.
+
+Flagconf supports nesting by recursively inspecting structs
 and creating them as necessary when the config value contains a nil struct pointer.
 In TOML, a struct corresponds to a nested section; in flags the name will be dot-separated:
 
@@ -182,15 +299,25 @@ In TOML, a struct corresponds to a nested section; in flags the name will be dot
     // and this flag
     -s.n=3
 
+A slice of structs (or of pointers to structs) is treated the same way as a
+TOML array of tables: once the config file has been decoded, one flag is
+registered per element already present, indexed by position, e.g.
+-servers.0.host and -servers.1.host for a `Servers []struct{ Host string }`
+field populated by two `[[servers]]` entries.
+
 Embedded structs are handled like in encoding/json: their exported fields are
 treated as if they were fields of the outer struct.
 
 Naming
 
-Matching names from TOML values to struct field names is much like encoding/json:
+Matching names from the config file to struct field names is much like encoding/json:
 exact matches are preferred and then case-insensitive matching will be accepted.
-(TOML names are typically lowercase, but the struct fields must be exported.)
-The struct tag "toml" can be used to set a different name.
+(Config-file names are typically lowercase, but the struct fields must be exported.)
+YAML files are the exception: a key matches only the lowercased field name
+or its "yaml" tag exactly, with no case-insensitive fallback.
+The struct tag matching the file's format ("toml", "json", or "yaml") can be
+used to set a different name; the "env" tag does the same for the
+environment-variable layer.
 
 The flag names are constructed by lowercasing the struct field name.
 The "flag" struct tag controls the flag name.
@@ -198,6 +325,14 @@ The "flag" struct tag controls the flag name.
     type Conf struct {
       Foo string `toml:"bar" flag:"baz"`
     }
+
+Other operations
+
+Watch parses a config file like Parse and then keeps it up to date as the
+file changes on disk, without overwriting anything set on the command line.
+Encode writes a config struct back out as TOML, which ParseStrings uses to
+implement the hidden -flagconf.dump-config and -flagconf.print-defaults
+flags for inspecting the effective (or default) configuration.
 */
 func Parse(path string, config interface{}) error {
 	return ParseStrings(os.Args, path, config, false)
@@ -223,13 +358,37 @@ func joinNS(ns, name string) string {
 	return ns + "." + name
 }
 
-func registerFlags(flagset *flag.FlagSet, v reflect.Value, namespace, description string) error {
-	if v.Kind() == reflect.Struct {
+// sliceStructElemKind reports whether t is a slice of structs or of
+// pointers to structs, in which case it returns reflect.Struct and whether
+// the element type is a pointer. Otherwise it returns the zero Kind.
+func sliceStructElemKind(t reflect.Type) (kind reflect.Kind, isPtr bool) {
+	if t.Kind() != reflect.Slice {
+		return 0, false
+	}
+	elem := t.Elem()
+	if elem.Kind() == reflect.Struct {
+		return reflect.Struct, false
+	}
+	if elem.Kind() == reflect.Ptr && elem.Elem().Kind() == reflect.Struct {
+		return reflect.Struct, true
+	}
+	return 0, false
+}
+
+// registerFlags walks v (the live config, already merged with the config
+// file) and defaults (a snapshot of v taken before the config file was
+// decoded) in lockstep, registering one flag per leaf field of v.
+func registerFlags(flagset *flag.FlagSet, v, defaults reflect.Value, namespace, description, envTag, envPrefix string, envBindings *[]envBinding) error {
+	// time.Time is a struct, but it's registered as a leaf below (like
+	// time.Duration) rather than recursed into, since its fields are
+	// unexported.
+	if v.Kind() == reflect.Struct && v.Type() != reflect.TypeOf(time.Time{}) {
 		for i := 0; i < v.NumField(); i++ {
 			field := v.Field(i)
 			if !field.CanSet() {
 				continue
 			}
+			defaultField := defaults.Field(i)
 			typ := v.Type().Field(i)
 			name := strings.ToLower(typ.Name)
 			if tag := typ.Tag.Get("flag"); tag != "" {
@@ -239,6 +398,7 @@ func registerFlags(flagset *flag.FlagSet, v reflect.Value, namespace, descriptio
 				name = tag
 			}
 			desc := typ.Tag.Get("desc")
+			env := typ.Tag.Get("env")
 			newNS := joinNS(namespace, name)
 			// For embedded fields don't create an extra nested namespace.
 			if v.Type().Field(i).Anonymous {
@@ -251,14 +411,78 @@ func registerFlags(flagset *flag.FlagSet, v reflect.Value, namespace, descriptio
 					field.Set(newField)
 				}
 				field = field.Elem()
+				// The default snapshot was taken before any nil struct
+				// pointers were allocated, so it may still be nil here; fall
+				// back to the zero value of the pointed-to struct.
+				if defaultField.IsNil() {
+					defaultField = reflect.New(defaultField.Type().Elem()).Elem()
+				} else {
+					defaultField = defaultField.Elem()
+				}
 			}
-			if err := registerFlags(flagset, field, newNS, desc); err != nil {
+			// A slice of structs (or pointers to structs) corresponds to a
+			// TOML array of tables. Its length is only known once the config
+			// file has been decoded, so register one set of indexed flags
+			// per element already present, e.g. -servers.0.host.
+			if elemKind, isPtr := sliceStructElemKind(field.Type()); elemKind == reflect.Struct {
+				for j := 0; j < field.Len(); j++ {
+					elem := field.Index(j)
+					elemType := elem.Type()
+					if isPtr {
+						elemType = elemType.Elem()
+					}
+					// The defaults snapshot was taken before the config file
+					// grew the slice, so most (often all) elements have no
+					// corresponding default; fall back to the zero value.
+					defaultElem := reflect.New(elemType).Elem()
+					if isPtr {
+						if elem.IsNil() {
+							elem.Set(reflect.New(elem.Type().Elem()))
+						}
+						elem = elem.Elem()
+						if j < defaultField.Len() && !defaultField.Index(j).IsNil() {
+							defaultElem = defaultField.Index(j).Elem()
+						}
+					} else if j < defaultField.Len() {
+						defaultElem = defaultField.Index(j)
+					}
+					elemNS := joinNS(newNS, strconv.Itoa(j))
+					if err := registerFlags(flagset, elem, defaultElem, elemNS, desc, env, envPrefix, envBindings); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if err := registerFlags(flagset, field, defaultField, newNS, desc, env, envPrefix, envBindings); err != nil {
 				return err
 			}
 		}
 		return nil
 	}
 
+	f, err := registerLeafFlag(flagset, v, namespace, description)
+	if err != nil {
+		return err
+	}
+	addEnvBinding(envBindings, v, namespace, envTag, envPrefix)
+
+	// registerLeafFlag just bound the flag to v, which already holds the
+	// config-file value, so flag.Flag.DefValue reflects the config file
+	// rather than the caller's original Go default. Recompute it from
+	// defaults, using a throwaway flagset so the same formatting logic runs
+	// without touching the live value bound above.
+	scratch := flag.NewFlagSet("", flag.ContinueOnError)
+	scratchValue := reflect.New(v.Type()).Elem()
+	scratchValue.Set(defaults)
+	if scratchFlag, err := registerLeafFlag(scratch, scratchValue, namespace, description); err == nil {
+		f.DefValue = scratchFlag.DefValue
+	}
+	return nil
+}
+
+// registerLeafFlag registers a single flag on flagset, bound to the
+// addressable leaf value v, and returns the *flag.Flag that was registered.
+func registerLeafFlag(flagset *flag.FlagSet, v reflect.Value, namespace, description string) (*flag.Flag, error) {
 	name := reflect.ValueOf(namespace)
 	usage := reflect.ValueOf(description)
 	if description == "" {
@@ -282,26 +506,33 @@ func registerFlags(flagset *flag.FlagSet, v reflect.Value, namespace, descriptio
 		flagFunc = reflect.ValueOf(flagset.UintVar)
 	case reflect.TypeOf(uint64(0)):
 		flagFunc = reflect.ValueOf(flagset.Uint64Var)
+	case reflect.TypeOf(time.Duration(0)):
+		flagFunc = reflect.ValueOf(flagset.DurationVar)
+	case reflect.TypeOf(time.Time{}):
+		// TOML decodes time.Time natively, but flag has no DurationVar-style
+		// helper for it, so it needs its own flag.Value wrapper.
+		flagset.Var(newTimeValue(v), namespace, usage.String())
+		return flagset.Lookup(namespace), nil
 	default:
 		// reflect.Type of flag.Value
 		fvt := reflect.TypeOf((*flag.Value)(nil)).Elem()
 		if v.Type().Implements(fvt) {
 			flagset.Var(v.Interface().(flag.Value), namespace, usage.String())
-			return nil
+			return flagset.Lookup(namespace), nil
 		}
 		// If value is addressable, its pointer may implement flag.Value
 		if v.CanAddr() && v.Addr().Type().Implements(fvt) {
 			flagset.Var(v.Addr().Interface().(flag.Value), namespace, usage.String())
-			return nil
+			return flagset.Lookup(namespace), nil
 		}
 
-		return fmt.Errorf("flagconf: unhandled type: %s", v.Type())
+		return nil, fmt.Errorf("flagconf: unhandled type: %s", v.Type())
 	}
 
 	p := v.Addr()
 	args := []reflect.Value{p, name, v, usage}
 	flagFunc.Call(args)
-	return nil
+	return flagset.Lookup(namespace), nil
 }
 
 // Strings is a convenience wrapper around a string slice that implements
@@ -344,3 +575,29 @@ func (is *Ints) Set(ss string) error {
 	}
 	return nil
 }
+
+// timeValue adapts a *time.Time to flag.Value, using RFC3339 for both the
+// flag's default text and command-line values. It is only used for flags;
+// setFromString parses environment variables as RFC3339 itself, and TOML
+// decodes time.Time fields natively.
+type timeValue time.Time
+
+func newTimeValue(v reflect.Value) *timeValue {
+	return (*timeValue)(v.Addr().Interface().(*time.Time))
+}
+
+func (t *timeValue) String() string {
+	if t == nil || time.Time(*t).IsZero() {
+		return ""
+	}
+	return time.Time(*t).Format(time.RFC3339)
+}
+
+func (t *timeValue) Set(s string) error {
+	parsed, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return err
+	}
+	*t = timeValue(parsed)
+	return nil
+}
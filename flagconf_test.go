@@ -77,6 +77,23 @@ type sliceCase struct {
 	F Ints
 }
 
+type server struct {
+	Host string
+}
+
+type serversCase struct {
+	Servers []server
+}
+
+type serversPtrCase struct {
+	Servers []*server
+}
+
+type timeCase struct {
+	Dur time.Duration
+	At  time.Time
+}
+
 type embeddedCase struct {
 	EmbeddedInner
 }
@@ -203,6 +220,51 @@ f = [1, 2]`,
 		args:      []string{"-f1=1"},
 		expectErr: true,
 	},
+	{
+		config: &serversCase{},
+		toml: `[[servers]]
+host = "a"
+
+[[servers]]
+host = "b"`,
+		args: []string{"-servers.1.host=c"},
+		expected: &serversCase{Servers: []server{
+			{Host: "a"},
+			{Host: "c"},
+		}},
+	},
+	{
+		config: &serversPtrCase{},
+		toml: `[[servers]]
+host = "a"
+
+[[servers]]
+host = "b"`,
+		args: nil,
+		expected: &serversPtrCase{Servers: []*server{
+			{Host: "a"},
+			{Host: "b"},
+		}},
+	},
+	{
+		config: &timeCase{},
+		toml: `dur = 5000000000
+at = 2020-01-02T15:04:05Z`,
+		args: nil,
+		expected: &timeCase{
+			Dur: 5 * time.Second,
+			At:  time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC),
+		},
+	},
+	{
+		config: &timeCase{},
+		toml:   "",
+		args:   []string{"-dur=10s", "-at=2021-06-07T08:09:10Z"},
+		expected: &timeCase{
+			Dur: 10 * time.Second,
+			At:  time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC),
+		},
+	},
 	{
 		config:   &embeddedCase{},
 		toml:     "f = 3",
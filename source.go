@@ -0,0 +1,68 @@
+package flagconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// A Source decodes the configuration file at path into v, which is a
+// pointer to the configuration struct passed to ParseStrings.
+type Source interface {
+	Decode(path string, v interface{}) error
+}
+
+// SourceFunc adapts an ordinary function to a Source.
+type SourceFunc func(path string, v interface{}) error
+
+// Decode calls f(path, v).
+func (f SourceFunc) Decode(path string, v interface{}) error {
+	return f(path, v)
+}
+
+// tomlSource decodes TOML configuration files using struct tags named "toml".
+var tomlSource = SourceFunc(func(path string, v interface{}) error {
+	_, err := toml.DecodeFile(path, v)
+	return err
+})
+
+// jsonSource decodes JSON configuration files using struct tags named "json".
+var jsonSource = SourceFunc(func(path string, v interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewDecoder(f).Decode(v)
+})
+
+// yamlSource decodes YAML configuration files using struct tags named "yaml".
+var yamlSource = SourceFunc(func(path string, v interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(b, v)
+})
+
+// sourceForPath returns the built-in Source registered for the file
+// extension of path: ".toml" (also used when there is no extension, for
+// backwards compatibility), ".json", or ".yaml"/".yml".
+func sourceForPath(path string) (Source, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".toml", "":
+		return tomlSource, nil
+	case ".json":
+		return jsonSource, nil
+	case ".yaml", ".yml":
+		return yamlSource, nil
+	default:
+		return nil, fmt.Errorf("flagconf: no Source registered for extension %q", ext)
+	}
+}
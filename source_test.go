@@ -0,0 +1,68 @@
+package flagconf
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func checkCaseWithExt(t *testing.T, ext, contents string, test *testCase) {
+	tempfile, err := ioutil.TempFile("", "flagconf-test-*"+ext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := tempfile.Name()
+	defer os.Remove(name)
+	if _, err := tempfile.WriteString(contents); err != nil {
+		t.Fatal(err)
+	}
+	if err := tempfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	args := append([]string{"test"}, test.args...)
+	err = ParseStrings(args, name, test.config, false)
+	if test.expectErr {
+		if err == nil {
+			t.Fatal("parsing succeeded when it was expected to fail")
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("parsing failed when it was expected to succeed: %s", err)
+	}
+	if !reflect.DeepEqual(test.config, test.expected) {
+		t.Fatalf("Expected %#v, but got %#v.", test.expected, test.config)
+	}
+}
+
+func TestJSONSource(t *testing.T) {
+	checkCaseWithExt(t, ".json", `{"f1": 3}`, &testCase{
+		config:   &simpleCase{},
+		args:     []string{"-f1=4"},
+		expected: &simpleCase{F1: 4},
+	})
+	checkCaseWithExt(t, ".json", `{"f1": 3}`, &testCase{
+		config:   &simpleCase{},
+		expected: &simpleCase{F1: 3},
+	})
+}
+
+func TestYAMLSource(t *testing.T) {
+	checkCaseWithExt(t, ".yaml", "f1: 3\n", &testCase{
+		config:   &simpleCase{},
+		args:     []string{"-f1=4"},
+		expected: &simpleCase{F1: 4},
+	})
+	checkCaseWithExt(t, ".yml", "f1: 3\n", &testCase{
+		config:   &simpleCase{},
+		expected: &simpleCase{F1: 3},
+	})
+}
+
+func TestUnknownSourceExtension(t *testing.T) {
+	if err := ParseStrings([]string{"test"}, "config.ini", &simpleCase{}, true); err == nil {
+		t.Fatal("expected error for unrecognized extension, got nil")
+	}
+}
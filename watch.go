@@ -0,0 +1,228 @@
+package flagconf
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watch is like Parse except that, after the initial parse, it continues to
+// watch the TOML file at path for changes using fsnotify. Whenever the file
+// is modified it is re-decoded and the new values are copied into config.
+//
+// Unlike Parse, Watch always decodes path as TOML; it does not go through
+// the pluggable Source used for JSON/YAML config files, so it is not
+// suitable for hot-reloading those formats.
+//
+// The initial parse honors the same defaults -> config file -> environment
+// -> flags precedence as Parse, using the "env" struct tag with no prefix
+// (there is no Options parameter to supply one). Fields that were set with a
+// command-line flag during the initial parse keep their command-line value
+// forever; they are never overwritten by a later reload. All other fields
+// are reset to their original default and then re-populated from the
+// reloaded file, exactly as during the initial parse; reloads do not
+// re-apply the environment layer.
+//
+// Because reloads happen on a background goroutine, config's fields are
+// mutated concurrently with any reads a caller does. The returned mutex
+// guards config: hold a read lock (RLock/RUnlock) around any read of
+// config's fields made outside onReload.
+//
+// onReload, if non-nil, is called after every reload attempt with the error
+// returned by that attempt (nil on success), and with any error reported by
+// the fsnotify watcher. Every call holds the write lock on mu, so onReload
+// may read config's fields directly and must not lock mu itself. It is not
+// called for the initial parse.
+//
+// Watch also returns a stop function that stops watching path and releases
+// the underlying fsnotify watcher; it does not affect config, which retains
+// its last-loaded values.
+func Watch(path string, config interface{}, onReload func(error)) (mu *sync.RWMutex, stop func(), err error) {
+	v := reflect.ValueOf(config)
+	if v.Kind() != reflect.Ptr || reflect.Indirect(v).Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("flagconf: config must be a pointer to a struct")
+	}
+	elem := reflect.Indirect(v)
+
+	// Keep a copy of the defaults so that each reload starts from the same
+	// baseline as the initial parse, rather than from zero values.
+	defaults := reflect.New(elem.Type())
+	defaults.Elem().Set(elem)
+
+	if _, err := toml.DecodeFile(path, config); err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	flagset := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	var envBindings []envBinding
+	if err := registerFlags(flagset, elem, defaults.Elem(), "", "", "", "", &envBindings); err != nil {
+		return nil, nil, err
+	}
+	if err := applyEnv(envBindings); err != nil {
+		return nil, nil, err
+	}
+	if err := flagset.Parse(os.Args[1:]); err != nil {
+		return nil, nil, err
+	}
+
+	flagSet := make(map[string]bool)
+	flagset.Visit(func(f *flag.Flag) {
+		flagSet[f.Name] = true
+	})
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := watcher.Add(path); err != nil {
+		watcher.Close()
+		return nil, nil, err
+	}
+
+	mu = &sync.RWMutex{}
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				// Many editors and config-management tools (e.g. Kubernetes
+				// ConfigMaps) replace the file atomically via rename, which
+				// removes it from the watch; re-add it so future changes are
+				// still seen.
+				if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+					watcher.Add(path)
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				mu.Lock()
+				fresh := reflect.New(elem.Type())
+				fresh.Elem().Set(defaults.Elem())
+				_, err := toml.DecodeFile(path, fresh.Interface())
+				if err == nil {
+					copyReloaded(elem, fresh.Elem(), "", flagSet)
+				}
+				if onReload != nil {
+					onReload(err)
+				}
+				mu.Unlock()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				if onReload != nil {
+					mu.Lock()
+					onReload(err)
+					mu.Unlock()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	stop = func() {
+		close(done)
+		watcher.Close()
+	}
+	return mu, stop, nil
+}
+
+// copyReloaded copies every field of src into the corresponding field of
+// dst, except fields whose flag name (given the same namespace rules as
+// registerFlags) is present in flagSet.
+func copyReloaded(dst, src reflect.Value, namespace string, flagSet map[string]bool) {
+	// time.Time is a struct, but (like registerFlags) it's treated as a leaf
+	// here rather than recursed into: its fields are unexported, so
+	// dstField.CanSet() would be false for all of them and the value would
+	// never be updated by a reload.
+	if dst.Type() == reflect.TypeOf(time.Time{}) {
+		if !flagSet[namespace] {
+			dst.Set(src)
+		}
+		return
+	}
+	if dst.Kind() == reflect.Struct {
+		for i := 0; i < dst.NumField(); i++ {
+			dstField := dst.Field(i)
+			if !dstField.CanSet() {
+				continue
+			}
+			typ := dst.Type().Field(i)
+			name := strings.ToLower(typ.Name)
+			if tag := typ.Tag.Get("flag"); tag != "" {
+				if tag == "-" {
+					// No flag can have set this field, so it takes the
+					// reloaded value as a whole.
+					dstField.Set(src.Field(i))
+					continue
+				}
+				name = tag
+			}
+			newNS := joinNS(namespace, name)
+			if typ.Anonymous {
+				newNS = namespace
+			}
+			srcField := src.Field(i)
+			if dstField.Kind() == reflect.Ptr && dstField.Type().Elem().Kind() == reflect.Struct {
+				// A nil pointer in the reloaded value stands for the zero
+				// struct, as it does for registerFlags' defaults.
+				srcElem := reflect.New(dstField.Type().Elem()).Elem()
+				if !srcField.IsNil() {
+					srcElem = srcField.Elem()
+				}
+				if dstField.IsNil() {
+					dstField.Set(reflect.New(dstField.Type().Elem()))
+				}
+				copyReloaded(dstField.Elem(), srcElem, newNS, flagSet)
+				continue
+			}
+			copyReloaded(dstField, srcField, newNS, flagSet)
+		}
+		return
+	}
+	// A slice of structs (or pointers to structs) is a TOML array of
+	// tables; recurse per-element the same way registerFlags does,
+	// instead of replacing the whole slice, so that flag overrides on
+	// individual elements (e.g. -servers.1.host) survive a reload.
+	if elemKind, isPtr := sliceStructElemKind(dst.Type()); elemKind == reflect.Struct {
+		result := reflect.MakeSlice(dst.Type(), src.Len(), src.Len())
+		for j := 0; j < src.Len(); j++ {
+			elemNS := joinNS(namespace, strconv.Itoa(j))
+			srcElem := src.Index(j)
+			if isPtr {
+				dstElem := reflect.New(dst.Type().Elem().Elem())
+				if j < dst.Len() && !dst.Index(j).IsNil() {
+					dstElem.Elem().Set(dst.Index(j).Elem())
+				}
+				if !srcElem.IsNil() {
+					copyReloaded(dstElem.Elem(), srcElem.Elem(), elemNS, flagSet)
+				}
+				result.Index(j).Set(dstElem)
+				continue
+			}
+			dstElem := reflect.New(dst.Type().Elem()).Elem()
+			if j < dst.Len() {
+				dstElem.Set(dst.Index(j))
+			}
+			copyReloaded(dstElem, srcElem, elemNS, flagSet)
+			result.Index(j).Set(dstElem)
+		}
+		dst.Set(result)
+		return
+	}
+	if flagSet[namespace] {
+		return
+	}
+	dst.Set(src)
+}
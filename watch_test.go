@@ -0,0 +1,214 @@
+package flagconf
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+type watchCase struct {
+	F1 int
+	F2 int
+}
+
+func TestWatch(t *testing.T) {
+	tempfile, err := ioutil.TempFile("", "flagconf-watch-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := tempfile.Name()
+	defer os.Remove(name)
+	if _, err := tempfile.WriteString("f1 = 1\nf2 = 1\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tempfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	oldArgs := os.Args
+	os.Args = []string{"test", "-f2=99"}
+	defer func() { os.Args = oldArgs }()
+
+	config := &watchCase{}
+	reloaded := make(chan error, 1)
+	mu, stop, err := Watch(name, config, func(err error) { reloaded <- err })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	mu.RLock()
+	f1, f2 := config.F1, config.F2
+	mu.RUnlock()
+	if f1 != 1 || f2 != 99 {
+		t.Fatalf("after initial parse: got F1=%d, F2=%d", f1, f2)
+	}
+
+	if err := ioutil.WriteFile(name, []byte("f1 = 2\nf2 = 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reload")
+	}
+
+	mu.RLock()
+	f1, f2 = config.F1, config.F2
+	mu.RUnlock()
+	if f1 != 2 {
+		t.Errorf("F1 = %d, want 2 (updated by reload)", f1)
+	}
+	if f2 != 99 {
+		t.Errorf("F2 = %d, want 99 (flag value must survive reload)", f2)
+	}
+}
+
+func TestWatchEnvOverlay(t *testing.T) {
+	withEnv(t, map[string]string{"MY_F1": "5"}, func() {
+		name := tempConfigFile(t, "")
+		defer os.Remove(name)
+
+		oldArgs := os.Args
+		os.Args = []string{"test"}
+		defer func() { os.Args = oldArgs }()
+
+		config := &envCase{}
+		mu, stop, err := Watch(name, config, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stop()
+
+		mu.RLock()
+		f1 := config.F1
+		mu.RUnlock()
+		if f1 != 5 {
+			t.Fatalf("after initial parse: got F1=%d, want 5 (from MY_F1)", f1)
+		}
+	})
+}
+
+type watchTimeCase struct {
+	N time.Time `toml:"n" flag:"n"`
+}
+
+func TestWatchTime(t *testing.T) {
+	tempfile, err := ioutil.TempFile("", "flagconf-watch-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := tempfile.Name()
+	defer os.Remove(name)
+	if _, err := tempfile.WriteString("n = 2020-01-01T00:00:00Z\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tempfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	oldArgs := os.Args
+	os.Args = []string{"test"}
+	defer func() { os.Args = oldArgs }()
+
+	config := &watchTimeCase{}
+	reloaded := make(chan error, 1)
+	mu, stop, err := Watch(name, config, func(err error) { reloaded <- err })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	want := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	mu.RLock()
+	n := config.N
+	mu.RUnlock()
+	if !n.Equal(want) {
+		t.Fatalf("after initial parse: got N=%v, want %v", n, want)
+	}
+
+	if err := ioutil.WriteFile(name, []byte("n = 2021-06-15T00:00:00Z\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reload")
+	}
+
+	want = time.Date(2021, 6, 15, 0, 0, 0, 0, time.UTC)
+	mu.RLock()
+	n = config.N
+	mu.RUnlock()
+	if !n.Equal(want) {
+		t.Errorf("N = %v, want %v (updated by reload)", n, want)
+	}
+}
+
+func TestWatchSliceOfStructs(t *testing.T) {
+	tempfile, err := ioutil.TempFile("", "flagconf-watch-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := tempfile.Name()
+	defer os.Remove(name)
+	initial := "[[servers]]\nhost = \"a\"\n\n[[servers]]\nhost = \"b\"\n"
+	if _, err := tempfile.WriteString(initial); err != nil {
+		t.Fatal(err)
+	}
+	if err := tempfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	oldArgs := os.Args
+	os.Args = []string{"test", "-servers.1.host=FLAGVALUE"}
+	defer func() { os.Args = oldArgs }()
+
+	config := &serversCase{}
+	reloaded := make(chan error, 1)
+	mu, stop, err := Watch(name, config, func(err error) { reloaded <- err })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	mu.RLock()
+	host1 := config.Servers[1].Host
+	mu.RUnlock()
+	if host1 != "FLAGVALUE" {
+		t.Fatalf("after initial parse: got %+v", config)
+	}
+
+	updated := "[[servers]]\nhost = \"a2\"\n\n[[servers]]\nhost = \"b2\"\n"
+	if err := ioutil.WriteFile(name, []byte(updated), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reload")
+	}
+
+	mu.RLock()
+	host0, host1 := config.Servers[0].Host, config.Servers[1].Host
+	mu.RUnlock()
+	if host0 != "a2" {
+		t.Errorf("Servers[0].Host = %q, want %q (updated by reload)", host0, "a2")
+	}
+	if host1 != "FLAGVALUE" {
+		t.Errorf("Servers[1].Host = %q, want %q (flag value must survive reload)", host1, "FLAGVALUE")
+	}
+}